@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	snapclient "github.com/kubernetes-csi/external-snapshotter/pkg/client/clientset/versioned"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+// CloneController watches target pvcs carrying AnnCloneRequest and drives their clone: a CSI
+// VolumeSnapshot-based smart clone when the source pvc's StorageClass supports it (see
+// attemptSmartClone in smartclone.go), falling back to the source/target pod pipeline otherwise.
+type CloneController struct {
+	clientset      kubernetes.Interface
+	snapshotClient snapclient.Interface
+	podInformer    cache.SharedIndexInformer
+	pvcInformer    cache.SharedIndexInformer
+	recorder       record.EventRecorder
+	image          string
+	verbose        string
+	pullPolicy     string
+}
+
+// NewCloneController creates a CloneController. snapshotClient may be nil when no CSI snapshotter
+// is available in the cluster; attemptSmartClone treats that as "smart clone disabled" and every
+// clone then falls back to the source/target pod pipeline.
+func NewCloneController(clientset kubernetes.Interface, snapshotClient snapclient.Interface, podInformer, pvcInformer cache.SharedIndexInformer, recorder record.EventRecorder, image, verbose, pullPolicy string) *CloneController {
+	return &CloneController{
+		clientset:      clientset,
+		snapshotClient: snapshotClient,
+		podInformer:    podInformer,
+		pvcInformer:    pvcInformer,
+		recorder:       recorder,
+		image:          image,
+		verbose:        verbose,
+		pullPolicy:     pullPolicy,
+	}
+}
+
+// reconcilePvc drives the clone for pvc once it passes checkClonePVC: it first attempts a smart
+// clone, then falls back to creating the source/target pod pair. A failed smart-clone attempt is
+// logged and does not abort the reconcile, per attemptSmartClone's documented fallback contract.
+func (c *CloneController) reconcilePvc(pvc *v1.PersistentVolumeClaim) error {
+	if !checkClonePVC(pvc) {
+		return nil
+	}
+
+	cr, err := getCloneRequestPVC(pvc)
+	if err != nil {
+		return err
+	}
+
+	smartCloned, err := attemptSmartClone(c.clientset, c.snapshotClient, cr, pvc)
+	if err != nil {
+		glog.Warningf("smart clone attempt for pvc \"%s/%s\" failed, falling back to pod-based clone: %v\n", pvc.Namespace, pvc.Name, err)
+	}
+	if smartCloned {
+		return nil
+	}
+
+	// A smart clone attempt may have deleted and recreated pvc (see recreateTargetPvcWithDataSource
+	// in smartclone.go); re-fetch it rather than reuse our now possibly-stale copy, whose UID/name
+	// could otherwise end up in the fallback pods' owner references and volume claims.
+	livePvc, err := c.clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(pvc.Name, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "error re-fetching pvc before pod-based clone fallback")
+	}
+
+	sourcePvcNamespace, _ := ParseSourcePvcAnnotation(cr, "/")
+	if _, err := CreateCloneSourcePod(c.clientset, c.image, c.verbose, c.pullPolicy, cr, livePvc); err != nil {
+		return errors.Wrap(err, "error creating clone source pod")
+	}
+	if _, err := CreateCloneTargetPod(c.clientset, c.image, c.verbose, c.pullPolicy, livePvc, sourcePvcNamespace); err != nil {
+		return errors.Wrap(err, "error creating clone target pod")
+	}
+	return nil
+}
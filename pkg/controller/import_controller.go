@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+// ImportController watches pvcs carrying AnnEndpoint and drives the importer pod that copies the
+// endpoint's content into the pvc.
+type ImportController struct {
+	clientset   kubernetes.Interface
+	pvcInformer cache.SharedIndexInformer
+	recorder    record.EventRecorder
+	image       string
+	verbose     string
+	pullPolicy  string
+	vaultCfg    *vaultConfig
+}
+
+// NewImportController creates an ImportController, resolving the Vault backend config once from
+// the controller's environment (see newVaultConfigFromEnv) so every importer pod it creates shares
+// the same vault settings.
+func NewImportController(clientset kubernetes.Interface, pvcInformer cache.SharedIndexInformer, recorder record.EventRecorder, image, verbose, pullPolicy string) (*ImportController, error) {
+	vaultCfg, err := newVaultConfigFromEnv()
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving vault config")
+	}
+	return &ImportController{
+		clientset:   clientset,
+		pvcInformer: pvcInformer,
+		recorder:    recorder,
+		image:       image,
+		verbose:     verbose,
+		pullPolicy:  pullPolicy,
+		vaultCfg:    vaultCfg,
+	}, nil
+}
+
+// reconcilePvc drives the importer pod for pvc once it passes checkPVC, threading the controller's
+// resolved vaultCfg through to CreateImporterPod.
+func (c *ImportController) reconcilePvc(pvc *v1.PersistentVolumeClaim) error {
+	if !checkPVC(pvc, c.recorder) {
+		return nil
+	}
+
+	ep, err := getEndpoint(pvc)
+	if err != nil {
+		return err
+	}
+	secretName, err := getSecretName(c.clientset, pvc)
+	if err != nil {
+		return err
+	}
+
+	if _, err := CreateImporterPod(c.clientset, c.vaultCfg, c.image, c.verbose, c.pullPolicy, ep, secretName, pvc); err != nil {
+		return errors.Wrap(err, "error creating importer pod")
+	}
+	return nil
+}
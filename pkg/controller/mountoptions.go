@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"strings"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// AnnMountOptions, when present on a pvc, holds a comma-separated list of mount options (e.g.
+// "noatime,discard") to apply the same way a CSI StorageClass's mountOptions would.
+const AnnMountOptions = "cdi.kubevirt.io/storage.import.mountOptions"
+
+// AnnFilesystem, when present on a pvc, names the filesystem (e.g. "ext4", "xfs", "raw") the
+// importer should format a raw block PVC to, or expect of an already-formatted PVC.
+const AnnFilesystem = "cdi.kubevirt.io/storage.import.filesystem"
+
+// importerMountOptionsEnvVar/importerFilesystemEnvVar are the env vars the importer/cloner
+// containers read to learn the requested mount options and filesystem.
+const (
+	importerMountOptionsEnvVar = "IMPORTER_MOUNT_OPTIONS"
+	importerFilesystemEnvVar   = "IMPORTER_FILESYSTEM"
+)
+
+// supportedFilesystems lists the filesystems the importer image knows how to format/mount.
+var supportedFilesystems = map[string]bool{
+	"ext4": true,
+	"xfs":  true,
+	"raw":  true,
+}
+
+// getMountOptions returns the comma-separated AnnMountOptions annotation split into individual
+// options, or nil if the annotation is absent or empty.
+func getMountOptions(pvc *v1.PersistentVolumeClaim) []string {
+	raw, found := pvc.Annotations[AnnMountOptions]
+	if !found || raw == "" {
+		return nil
+	}
+	return strings.Split(raw, ",")
+}
+
+// getFilesystem returns the AnnFilesystem annotation value, or "" if absent.
+func getFilesystem(pvc *v1.PersistentVolumeClaim) string {
+	return pvc.Annotations[AnnFilesystem]
+}
+
+// validateFilesystem checks fs (the AnnFilesystem annotation on pvc) against the filesystems the
+// importer image supports. If recorder is non-nil, an Event is surfaced on the pvc when the
+// filesystem is unsupported.
+func validateFilesystem(pvc *v1.PersistentVolumeClaim, recorder record.EventRecorder) bool {
+	fs := getFilesystem(pvc)
+	if fs == "" {
+		return true
+	}
+	if supportedFilesystems[fs] {
+		return true
+	}
+	glog.V(1).Infof("pvc \"%s/%s\" requests unsupported filesystem %q\n", pvc.Namespace, pvc.Name, fs)
+	if recorder != nil {
+		recorder.Eventf(pvc, v1.EventTypeWarning, "UnsupportedFilesystem", "filesystem %q requested in annotation %q is not supported by the importer image", fs, AnnFilesystem)
+	}
+	return false
+}
+
+// mountOptionsVolumeMount returns the plain VolumeMount for name/path. There is no Kubernetes
+// VolumeMount field that applies extra mount options to an already-provisioned PVC, so
+// AnnMountOptions has no effect here: it is conveyed to the importer/cloner container via
+// mountOptionsEnv, and it is up to the importer image to remount DataVolName/ImagePathName with
+// IMPORTER_MOUNT_OPTIONS once it starts, before writing the image to it.
+func mountOptionsVolumeMount(name, path string) v1.VolumeMount {
+	return v1.VolumeMount{Name: name, MountPath: path}
+}
+
+// mountOptionsEnv returns additional env vars conveying AnnMountOptions/AnnFilesystem to the
+// importer/cloner container, to be appended to the container's base Env. The importer image is
+// responsible for actually applying IMPORTER_MOUNT_OPTIONS (e.g. via a remount of its data volume
+// mount point at startup); see mountOptionsVolumeMount.
+func mountOptionsEnv(pvc *v1.PersistentVolumeClaim) []v1.EnvVar {
+	var env []v1.EnvVar
+	if opts := getMountOptions(pvc); len(opts) > 0 {
+		env = append(env, v1.EnvVar{Name: importerMountOptionsEnvVar, Value: strings.Join(opts, ",")})
+	}
+	if fs := getFilesystem(pvc); fs != "" {
+		env = append(env, v1.EnvVar{Name: importerFilesystemEnvVar, Value: fs})
+	}
+	return env
+}
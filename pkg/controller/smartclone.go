@@ -0,0 +1,247 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/pkg/apis/volumesnapshot/v1beta1"
+	snapclient "github.com/kubernetes-csi/external-snapshotter/pkg/client/clientset/versioned"
+	"k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// smartCloneSnapshotPrefix is prepended to the generated VolumeSnapshot name so it is easy to
+// recognize and garbage collect if cleanup via OwnerReferences is ever missed.
+const smartCloneSnapshotPrefix = "cdi-smart-clone"
+
+// attemptSmartClone looks for a CSI VolumeSnapshotClass backing the source PVC's StorageClass and,
+// if one exists, drives a CSI snapshot-based clone instead of the source/target pod pipeline. It
+// returns true when the smart clone was completed successfully and the target pvc has been
+// annotated with AnnCloneOf, in which case the caller should skip CreateCloneSourcePod/
+// CreateCloneTargetPod. Any error, or the absence of a matching VolumeSnapshotClass, causes a
+// (false, nil) or (false, err) return so the caller falls back to the existing pod-based clone flow.
+func attemptSmartClone(client kubernetes.Interface, snapshotClient snapclient.Interface, cr string, targetPvc *v1.PersistentVolumeClaim) (bool, error) {
+	if snapshotClient == nil {
+		return false, nil
+	}
+
+	sourcePvcNamespace, sourcePvcName := ParseSourcePvcAnnotation(cr, "/")
+	if sourcePvcNamespace == "" || sourcePvcName == "" {
+		return false, errors.Errorf("Bad CloneRequest Annotation")
+	}
+
+	// A VolumeSnapshot's Source.PersistentVolumeClaimName resolves within the snapshot's own
+	// namespace, and spec.dataSource on a pvc resolves within that pvc's own namespace, so a
+	// cross-namespace smart clone has no way to reference the same VolumeSnapshot from both sides.
+	// Fall back to the pod-based clone pipeline, which copies data over the wire and has no such
+	// restriction.
+	if sourcePvcNamespace != targetPvc.Namespace {
+		glog.V(2).Infof("source pvc \"%s/%s\" and target pvc \"%s/%s\" are in different namespaces; smart clone requires them to match, falling back to pod-based clone\n",
+			sourcePvcNamespace, sourcePvcName, targetPvc.Namespace, targetPvc.Name)
+		return false, nil
+	}
+
+	// recreateTargetPvcWithDataSource deletes and recreates targetPvc; that is only safe while it
+	// is still unbound. A Bound pvc already owns a live PV, and deleting it risks releasing or
+	// destroying real data.
+	if targetPvc.Status.Phase == v1.ClaimBound {
+		glog.V(2).Infof("target pvc \"%s/%s\" is already bound, refusing to delete+recreate it for smart clone\n", targetPvc.Namespace, targetPvc.Name)
+		return false, nil
+	}
+
+	sourcePvc, err := client.CoreV1().PersistentVolumeClaims(sourcePvcNamespace).Get(sourcePvcName, metav1.GetOptions{})
+	if err != nil {
+		return false, errors.Wrapf(err, "error getting source pvc %q", sourcePvcNamespace+"/"+sourcePvcName)
+	}
+	if sourcePvc.Spec.StorageClassName == nil {
+		return false, nil
+	}
+
+	snapshotClass, err := findSnapshotClassForStorageClass(client, snapshotClient, *sourcePvc.Spec.StorageClassName)
+	if err != nil || snapshotClass == nil {
+		return false, err
+	}
+
+	snapshot, err := createCloneSnapshot(snapshotClient, snapshotClass.Name, sourcePvc, targetPvc)
+	if err != nil {
+		return false, errors.Wrap(err, "error creating smart-clone VolumeSnapshot")
+	}
+
+	if err := waitSnapshotReadyToUse(snapshotClient, snapshot.Namespace, snapshot.Name); err != nil {
+		return false, errors.Wrap(err, "error waiting for smart-clone VolumeSnapshot to become ready")
+	}
+
+	newTargetPvc, err := recreateTargetPvcWithDataSource(client, targetPvc, snapshot.Name)
+	if err != nil {
+		return false, errors.Wrap(err, "error recreating target pvc with smart-clone dataSource")
+	}
+
+	if err := adoptSmartCloneSnapshot(snapshotClient, snapshot, newTargetPvc); err != nil {
+		return false, errors.Wrap(err, "error adopting smart-clone VolumeSnapshot")
+	}
+
+	if _, err := setPVCAnnotation(client, newTargetPvc, AnnCloneOf, "true"); err != nil {
+		return false, errors.Wrap(err, "error annotating target pvc after smart clone")
+	}
+
+	glog.V(1).Infof("smart-cloned pvc \"%s/%s\" from source \"%s/%s\" via VolumeSnapshot %q\n",
+		targetPvc.Namespace, targetPvc.Name, sourcePvcNamespace, sourcePvcName, snapshot.Name)
+	return true, nil
+}
+
+// findSnapshotClassForStorageClass returns the VolumeSnapshotClass whose driver matches the CSI
+// driver backing storageClassName, or nil if the StorageClass isn't CSI-backed or no matching
+// VolumeSnapshotClass exists.
+func findSnapshotClassForStorageClass(client kubernetes.Interface, snapshotClient snapclient.Interface, storageClassName string) (*snapshotv1.VolumeSnapshotClass, error) {
+	sc, err := client.StorageV1().StorageClasses().Get(storageClassName, metav1.GetOptions{})
+	if err != nil {
+		if apierrs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "error getting storage class %q", storageClassName)
+	}
+
+	driver := csiDriverFromProvisioner(sc)
+	if driver == "" {
+		return nil, nil
+	}
+
+	classes, err := snapshotClient.SnapshotV1beta1().VolumeSnapshotClasses().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing volume snapshot classes")
+	}
+	for i := range classes.Items {
+		if classes.Items[i].Driver == driver {
+			return &classes.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// csiDriverFromProvisioner returns the CSI driver name backing sc, or "" if sc is not CSI-backed.
+func csiDriverFromProvisioner(sc *storagev1.StorageClass) string {
+	if sc.Provisioner == "" || sc.Provisioner == "kubernetes.io/no-provisioner" {
+		return ""
+	}
+	return sc.Provisioner
+}
+
+// createCloneSnapshot creates a VolumeSnapshot in the source namespace pointing at sourcePvc. It is
+// created without an owner reference: the eventual owner is the *recreated* target pvc (see
+// recreateTargetPvcWithDataSource/adoptSmartCloneSnapshot), which does not exist with a stable UID
+// until after the snapshot is ready to use.
+func createCloneSnapshot(snapshotClient snapclient.Interface, snapshotClassName string, sourcePvc, targetPvc *v1.PersistentVolumeClaim) (*snapshotv1.VolumeSnapshot, error) {
+	snapshot := &snapshotv1.VolumeSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: fmt.Sprintf("%s-%s-", smartCloneSnapshotPrefix, sourcePvc.Name),
+			Namespace:    sourcePvc.Namespace,
+		},
+		Spec: snapshotv1.VolumeSnapshotSpec{
+			VolumeSnapshotClassName: &snapshotClassName,
+			Source: snapshotv1.VolumeSnapshotSource{
+				PersistentVolumeClaimName: &sourcePvc.Name,
+			},
+		},
+	}
+	return snapshotClient.SnapshotV1beta1().VolumeSnapshots(sourcePvc.Namespace).Create(snapshot)
+}
+
+// waitSnapshotReadyToUse polls, using the same wait.PollImmediate pattern as updatePVC, until the
+// named VolumeSnapshot reports status.readyToUse.
+func waitSnapshotReadyToUse(snapshotClient snapclient.Interface, namespace, name string) error {
+	return wait.PollImmediate(time.Second*2, time.Minute*5, func() (bool, error) {
+		snapshot, err := snapshotClient.SnapshotV1beta1().VolumeSnapshots(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return snapshot.Status != nil && snapshot.Status.ReadyToUse != nil && *snapshot.Status.ReadyToUse, nil
+	})
+}
+
+// recreateTargetPvcWithDataSource deletes pvc and recreates it with spec.dataSource referencing the
+// smart-clone VolumeSnapshot. spec.dataSource is immutable once a pvc exists, so the API server
+// rejects an Update that sets it on a live pvc; the snapshot can only be wired in at creation time.
+// Callers must ensure pvc is still unbound (see the ClaimBound guard in attemptSmartClone) before
+// calling this. If the recreate fails, it makes a best-effort attempt to restore the original pvc
+// (without dataSource) so the caller's pod-based fallback still has a pvc to work with; either way,
+// the caller must re-fetch the pvc afterward rather than keep using its now-stale copy.
+func recreateTargetPvcWithDataSource(client kubernetes.Interface, pvc *v1.PersistentVolumeClaim, snapshotName string) (*v1.PersistentVolumeClaim, error) {
+	if err := client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Delete(pvc.Name, &metav1.DeleteOptions{}); err != nil && !apierrs.IsNotFound(err) {
+		return nil, errors.Wrapf(err, "error deleting pvc %q before smart-clone recreate", pvc.Namespace+"/"+pvc.Name)
+	}
+
+	newPvc := pvc.DeepCopy()
+	newPvc.ResourceVersion = ""
+	newPvc.UID = ""
+	newPvc.Spec.DataSource = &v1.TypedLocalObjectReference{
+		APIGroup: &snapshotv1.SchemeGroupVersion.Group,
+		Kind:     "VolumeSnapshot",
+		Name:     snapshotName,
+	}
+
+	var created *v1.PersistentVolumeClaim
+	err := wait.PollImmediate(time.Second*1, time.Second*30, func() (bool, error) {
+		var e error
+		created, e = client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Create(newPvc)
+		if e == nil {
+			return true, nil
+		}
+		if apierrs.IsAlreadyExists(e) {
+			// the delete above may not have finished propagating yet; retry.
+			return false, nil
+		}
+		return false, e
+	})
+	if err == nil {
+		return created, nil
+	}
+
+	restorePvc := pvc.DeepCopy()
+	restorePvc.ResourceVersion = ""
+	restorePvc.UID = ""
+	if _, rollbackErr := client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Create(restorePvc); rollbackErr != nil && !apierrs.IsAlreadyExists(rollbackErr) {
+		return nil, errors.Wrapf(err, "error recreating pvc %q with smart-clone dataSource, and restoring the original pvc also failed: %v", pvc.Namespace+"/"+pvc.Name, rollbackErr)
+	}
+	return nil, errors.Wrapf(err, "error recreating pvc %q with smart-clone dataSource; original pvc restored", pvc.Namespace+"/"+pvc.Name)
+}
+
+// adoptSmartCloneSnapshot sets snapshot's owner reference to owner so it is garbage collected along
+// with the target pvc, following the same retry-on-conflict shape as updatePVC.
+func adoptSmartCloneSnapshot(snapshotClient snapclient.Interface, snapshot *snapshotv1.VolumeSnapshot, owner *v1.PersistentVolumeClaim) error {
+	blockOwnerDeletion := true
+	isController := true
+	ownerRefs := []metav1.OwnerReference{
+		{
+			APIVersion:         "v1",
+			Kind:               "PersistentVolumeClaim",
+			Name:               owner.Name,
+			UID:                owner.GetUID(),
+			BlockOwnerDeletion: &blockOwnerDeletion,
+			Controller:         &isController,
+		},
+	}
+
+	snapCopy := snapshot.DeepCopy()
+	snapCopy.OwnerReferences = ownerRefs
+	return wait.PollImmediate(time.Second*1, time.Second*10, func() (bool, error) {
+		_, e := snapshotClient.SnapshotV1beta1().VolumeSnapshots(snapCopy.Namespace).Update(snapCopy)
+		if e == nil {
+			return true, nil
+		}
+		if apierrs.IsConflict(e) {
+			var getErr error
+			snapCopy, getErr = snapshotClient.SnapshotV1beta1().VolumeSnapshots(snapshot.Namespace).Get(snapshot.Name, metav1.GetOptions{})
+			if getErr == nil {
+				snapCopy.OwnerReferences = ownerRefs
+				return false, nil
+			}
+		}
+		return false, nil
+	})
+}
@@ -13,6 +13,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 
 	"kubevirt.io/containerized-data-importer/pkg/common"
 )
@@ -55,7 +56,7 @@ func (c *ImportController) objFromKey(informer cache.SharedIndexInformer, key in
 	return obj, true, nil
 }
 
-func checkPVC(pvc *v1.PersistentVolumeClaim) bool {
+func checkPVC(pvc *v1.PersistentVolumeClaim, recorder record.EventRecorder) bool {
 	if pvc.DeletionTimestamp != nil {
 		return false
 	}
@@ -66,6 +67,17 @@ func checkPVC(pvc *v1.PersistentVolumeClaim) bool {
 		return false
 	}
 
+	// AnnSecret and AnnEndpointVaultPath name two mutually exclusive credential backends; a pvc
+	// that sets both is misconfigured and cannot be serviced.
+	if metav1.HasAnnotation(pvc.ObjectMeta, AnnSecret) && metav1.HasAnnotation(pvc.ObjectMeta, AnnEndpointVaultPath) {
+		glog.V(1).Infof("pvc \"%s/%s\" sets both %q and %q, only one credential source is allowed\n", pvc.Namespace, pvc.Name, AnnSecret, AnnEndpointVaultPath)
+		return false
+	}
+
+	if !validateFilesystem(pvc, recorder) {
+		return false
+	}
+
 	return true
 }
 
@@ -184,9 +196,25 @@ func checkIfLabelExists(pvc *v1.PersistentVolumeClaim, lbl string, val string) b
 
 // CreateImporterPod creates and returns a pointer to a pod which is created based on the passed-in endpoint, secret
 // name, and pvc. A nil secret means the endpoint credentials are not passed to the
-// importer pod.
-func CreateImporterPod(client kubernetes.Interface, image, verbose, pullPolicy, ep, secretName string, pvc *v1.PersistentVolumeClaim) (*v1.Pod, error) {
+// importer pod. If pvc carries AnnEndpointVaultPath instead of AnnSecret, credentials are fetched
+// from Vault using vaultCfg and synthesized into a short-lived Secret owned by pvc.
+func CreateImporterPod(client kubernetes.Interface, vaultCfg *vaultConfig, image, verbose, pullPolicy, ep, secretName string, pvc *v1.PersistentVolumeClaim) (*v1.Pod, error) {
 	ns := pvc.Namespace
+
+	if vaultPath := getVaultPath(pvc); vaultPath != "" {
+		if vaultCfg == nil {
+			return nil, errors.Errorf("pvc \"%s/%s\" requests vault credentials but the controller has no vault config", ns, pvc.Name)
+		}
+		creds, err := getVaultCredentials(vaultCfg, vaultPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error fetching vault credentials for pvc \"%s/%s\"", ns, pvc.Name)
+		}
+		secretName, err = createVaultSecret(client, pvc, creds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	pod := MakeImporterPodSpec(image, verbose, pullPolicy, ep, secretName, pvc)
 
 	pod, err := client.CoreV1().Pods(ns).Create(pod)
@@ -237,10 +265,7 @@ func MakeImporterPodSpec(image, verbose, pullPolicy, ep, secret string, pvc *v1.
 					Image:           image,
 					ImagePullPolicy: v1.PullPolicy(pullPolicy),
 					VolumeMounts: []v1.VolumeMount{
-						{
-							Name:      DataVolName,
-							MountPath: common.ImporterDataDir,
-						},
+						mountOptionsVolumeMount(DataVolName, common.ImporterDataDir),
 					},
 					Args: []string{"-v=" + verbose},
 				},
@@ -259,7 +284,7 @@ func MakeImporterPodSpec(image, verbose, pullPolicy, ep, secret string, pvc *v1.
 			},
 		},
 	}
-	pod.Spec.Containers[0].Env = makeEnv(ep, secret)
+	pod.Spec.Containers[0].Env = append(makeEnv(ep, secret), mountOptionsEnv(pvc)...)
 	return pod
 }
 
@@ -394,16 +419,14 @@ func MakeCloneSourcePodSpec(image, verbose, pullPolicy, sourcePvcName string, pv
 						RunAsUser:  &[]int64{0}[0],
 					},
 					VolumeMounts: []v1.VolumeMount{
-						{
-							Name:      ImagePathName,
-							MountPath: common.ClonerImagePath,
-						},
+						mountOptionsVolumeMount(ImagePathName, common.ClonerImagePath),
 						{
 							Name:      socketPathName,
 							MountPath: common.ClonerSocketPath + "/" + id,
 						},
 					},
 					Args: []string{"source", id},
+					Env:  mountOptionsEnv(pvc),
 				},
 			},
 			RestartPolicy: v1.RestartPolicyNever,
@@ -509,16 +532,14 @@ func MakeCloneTargetPodSpec(image, verbose, pullPolicy, podAffinityNamespace str
 						RunAsUser:  &[]int64{0}[0],
 					},
 					VolumeMounts: []v1.VolumeMount{
-						{
-							Name:      ImagePathName,
-							MountPath: common.ClonerImagePath,
-						},
+						mountOptionsVolumeMount(ImagePathName, common.ClonerImagePath),
 						{
 							Name:      socketPathName,
 							MountPath: common.ClonerSocketPath + "/" + id,
 						},
 					},
 					Args: []string{"target", id},
+					Env:  mountOptionsEnv(pvc),
 				},
 			},
 			RestartPolicy: v1.RestartPolicyNever,
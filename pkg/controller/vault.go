@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"kubevirt.io/containerized-data-importer/pkg/common"
+)
+
+// Environment variables read once at controller startup to configure the Vault credential backend.
+// These mirror the ceph-csi Vault integration.
+const (
+	vaultAddrEnvVar      = "VAULT_ADDR"
+	vaultRoleEnvVar      = "VAULT_ROLE"
+	vaultCACertEnvVar    = "VAULT_CACERT"
+	vaultTokenFileEnvVar = "VAULT_TOKEN_FILE"
+
+	vaultKubernetesAuthMount = "kubernetes"
+	vaultServiceAccountPath  = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// AnnEndpointVaultPath, when present on a pvc, holds a Vault KV path (e.g. "secret/data/cdi/<pvc>")
+// from which the importer's endpoint credentials are fetched instead of from a k8s Secret named by
+// AnnSecret. The two annotations are mutually exclusive; see checkPVC.
+const AnnEndpointVaultPath = "cdi.kubevirt.io/storage.import.vaultPath"
+
+// vaultConfig holds the cluster-level Vault settings resolved once at controller startup.
+type vaultConfig struct {
+	addr     string
+	role     string
+	caCert   string
+	tokenFile string
+}
+
+// newVaultConfigFromEnv resolves vaultConfig from the controller's environment. It returns a nil
+// config (and no error) when VAULT_ADDR is unset, meaning the Vault backend is disabled.
+func newVaultConfigFromEnv() (*vaultConfig, error) {
+	addr := os.Getenv(vaultAddrEnvVar)
+	if addr == "" {
+		return nil, nil
+	}
+	role := os.Getenv(vaultRoleEnvVar)
+	if role == "" {
+		return nil, errors.Errorf("%s is required when %s is set", vaultRoleEnvVar, vaultAddrEnvVar)
+	}
+	return &vaultConfig{
+		addr:      addr,
+		role:      role,
+		caCert:    os.Getenv(vaultCACertEnvVar),
+		tokenFile: os.Getenv(vaultTokenFileEnvVar),
+	}, nil
+}
+
+// vaultCredentials holds the access/secret key pair retrieved from a Vault KV path.
+type vaultCredentials struct {
+	accessKey string
+	secretKey string
+}
+
+// getVaultCredentials authenticates to Vault using the Kubernetes auth method (or, if tokenFile is
+// set, a pre-provisioned token) and fetches accessKey/secretKey from the KV path stored in the pvc's
+// AnnEndpointVaultPath annotation.
+func getVaultCredentials(cfg *vaultConfig, vaultPath string) (*vaultCredentials, error) {
+	vaultCfg := &vaultapi.Config{Address: cfg.addr}
+	if cfg.caCert != "" {
+		if err := vaultCfg.ConfigureTLS(&vaultapi.TLSConfig{CACert: cfg.caCert}); err != nil {
+			return nil, errors.Wrap(err, "error configuring vault TLS")
+		}
+	}
+	client, err := vaultapi.NewClient(vaultCfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating vault client")
+	}
+
+	token, err := vaultLogin(client, cfg)
+	if err != nil {
+		return nil, err
+	}
+	client.SetToken(token)
+
+	secret, err := client.Logical().Read(vaultPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading vault path %q", vaultPath)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, errors.Errorf("no data found at vault path %q", vaultPath)
+	}
+
+	data := secret.Data
+	if nested, ok := secret.Data["data"].(map[string]interface{}); ok {
+		data = nested // KV v2 nests the actual secret under "data"
+	}
+
+	accessKey, _ := data["accessKey"].(string)
+	secretKey, _ := data["secretKey"].(string)
+	if accessKey == "" || secretKey == "" {
+		return nil, errors.Errorf("vault path %q is missing accessKey/secretKey", vaultPath)
+	}
+	return &vaultCredentials{accessKey: accessKey, secretKey: secretKey}, nil
+}
+
+// vaultLogin returns a Vault token, either read from cfg.tokenFile or obtained via the Kubernetes
+// auth method using the ServiceAccount token mounted into the controller's own pod
+// (vaultServiceAccountPath). The importer pod's ServiceAccount token is not used.
+func vaultLogin(client *vaultapi.Client, cfg *vaultConfig) (string, error) {
+	if cfg.tokenFile != "" {
+		b, err := ioutil.ReadFile(cfg.tokenFile)
+		if err != nil {
+			return "", errors.Wrapf(err, "error reading vault token file %q", cfg.tokenFile)
+		}
+		return string(b), nil
+	}
+
+	jwt, err := ioutil.ReadFile(vaultServiceAccountPath)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading service account token for vault kubernetes auth")
+	}
+
+	resp, err := client.Logical().Write(fmt.Sprintf("auth/%s/login", vaultKubernetesAuthMount), map[string]interface{}{
+		"role": cfg.role,
+		"jwt":  string(jwt),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error authenticating to vault via kubernetes auth method")
+	}
+	if resp == nil || resp.Auth == nil {
+		return "", errors.New("vault kubernetes auth returned no Auth info")
+	}
+	return resp.Auth.ClientToken, nil
+}
+
+// createVaultSecret synthesizes a short-lived k8s Secret holding the credentials fetched from
+// Vault, owned by pvc so it is GC'd with it. The returned secret name can be passed to makeEnv the
+// same way a user-supplied AnnSecret name is.
+func createVaultSecret(client kubernetes.Interface, pvc *v1.PersistentVolumeClaim, creds *vaultCredentials) (string, error) {
+	blockOwnerDeletion := true
+	isController := true
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: fmt.Sprintf("%s-vault-", pvc.Name),
+			Namespace:    pvc.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion:         "v1",
+					Kind:               "PersistentVolumeClaim",
+					Name:               pvc.Name,
+					UID:                pvc.GetUID(),
+					BlockOwnerDeletion: &blockOwnerDeletion,
+					Controller:         &isController,
+				},
+			},
+		},
+		StringData: map[string]string{
+			common.KeyAccess: creds.accessKey,
+			common.KeySecret: creds.secretKey,
+		},
+	}
+	created, err := client.CoreV1().Secrets(pvc.Namespace).Create(secret)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating synthesized vault secret")
+	}
+	glog.V(1).Infof("created vault-backed secret \"%s/%s\" for pvc \"%s/%s\"\n", created.Namespace, created.Name, pvc.Namespace, pvc.Name)
+	return created.Name, nil
+}
+
+// getVaultPath returns the value of AnnEndpointVaultPath on pvc, or "" if not set.
+func getVaultPath(pvc *v1.PersistentVolumeClaim) string {
+	return pvc.Annotations[AnnEndpointVaultPath]
+}
@@ -0,0 +1,64 @@
+package importer
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// archiveMemberQueryParam names the endpoint URL query parameter used to select which entry of a
+// multi-file tar archive (e.g. an OVA-style bundle) is exposed downstream. When absent, the first
+// regular file entry is selected.
+const archiveMemberQueryParam = "archiveMember"
+
+// selectTarMember parses the tar stream currently at the top of d.Readers and appends a reader
+// positioned at the chosen member (d.archiveMember if set, else the first regular file entry) as
+// the new top of the chain. Every entry encountered along the way is validated to reject path
+// traversal and symlink/hardlink entries, regardless of whether it is the one selected.
+func (d *DataStream) selectTarMember() error {
+	tr := tar.NewReader(d.topReader())
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			if d.archiveMember == "" {
+				return errors.New("tar archive contains no regular file entries")
+			}
+			return errors.Errorf("tar archive member %q not found", d.archiveMember)
+		}
+		if err != nil {
+			return errors.Wrap(err, "error reading tar archive")
+		}
+		if err := validateTarEntry(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if d.archiveMember == "" || hdr.Name == d.archiveMember {
+			d.appendReader(ioutil.NopCloser(tr))
+			return nil
+		}
+	}
+}
+
+// validateTarEntry rejects tar entries that could escape the extraction target (absolute paths,
+// ".." path segments) or that point at another file on disk (symlinks/hardlinks).
+func validateTarEntry(hdr *tar.Header) error {
+	if filepath.IsAbs(hdr.Name) {
+		return errors.Errorf("tar entry %q has an absolute path", hdr.Name)
+	}
+	for _, part := range strings.Split(hdr.Name, "/") {
+		if part == ".." {
+			return errors.Errorf("tar entry %q contains a \"..\" path segment", hdr.Name)
+		}
+	}
+	if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
+		return errors.Errorf("tar entry %q is a symlink/hardlink", hdr.Name)
+	}
+	return nil
+}
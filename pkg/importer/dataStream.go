@@ -0,0 +1,311 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+
+	"kubevirt.io/containerized-data-importer/pkg/image"
+)
+
+// qemuOperations is a package var so tests can swap it out via replaceQEMUOperations.
+var qemuOperations = image.NewQEMUOperations()
+
+// reader wraps an io.ReadCloser together with the pipeline depth (rdrLevel) it was constructed at,
+// so closeReaders can unwind the chain in order.
+type reader struct {
+	rdrLevel int
+	rdr      io.ReadCloser
+}
+
+// DataStream represents an endpoint being imported: its raw transport, and the chain of Readers
+// (decompression, untar, etc.) layered on top of it to produce a qcow2/raw image on disk.
+type DataStream struct {
+	url         *url.URL
+	buf         []byte
+	qemu        bool
+	Size        int64
+	Readers     []reader
+	accessKeyID string
+	secretKey   string
+
+	// digestAlgo/expectedDigest/hasher support optional content integrity verification; see
+	// NewDataStreamWithDigest and VerifyDigest in digest.go.
+	digestAlgo     string
+	expectedDigest string
+	hasher         hash.Hash
+
+	// archiveMember, when non-empty, selects which entry of a multi-file tar archive
+	// constructReaders exposes downstream; see archive.go. Populated from the endpoint URL's
+	// "archiveMember" query parameter.
+	archiveMember string
+}
+
+// ParseEndpoint parses endpt into a *url.URL. An endpoint without a scheme keeps an empty Scheme,
+// which dataStreamSelector treats as a local file.
+func ParseEndpoint(endpt string) (*url.URL, error) {
+	if endpt == "" {
+		return nil, errors.New("endpoint is empty")
+	}
+	u, err := url.Parse(endpt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing endpoint %q", endpt)
+	}
+	return u, nil
+}
+
+// NewDataStream constructs a DataStream for endpt and builds its reader chain.
+func NewDataStream(endpt, accKey, secKey string) (*DataStream, error) {
+	u, err := ParseEndpoint(endpt)
+	if err != nil {
+		return nil, err
+	}
+	ds := &DataStream{
+		url:           u,
+		buf:           make([]byte, image.MaxExpectedHdrSize),
+		accessKeyID:   accKey,
+		secretKey:     secKey,
+		archiveMember: u.Query().Get(archiveMemberQueryParam),
+	}
+	if err := ds.constructReaders(); err != nil {
+		closeReaders(ds.Readers)
+		return nil, errors.Wrap(err, "error constructing reader chain")
+	}
+	return ds, nil
+}
+
+// Read satisfies io.Reader by reading from the innermost (last) reader in the chain. It keeps
+// reading until buf is full, since the multi-readers in the chain return the peeked header bytes
+// as a short read of their own; fewer than len(buf) bytes are returned only at the end of the stream.
+func (d *DataStream) Read(buf []byte) (int, error) {
+	if len(d.Readers) == 0 {
+		return 0, errors.New("no readers available")
+	}
+	n, err := io.ReadFull(d.topReader(), buf)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Close closes every reader in the chain, innermost first.
+func (d *DataStream) Close() error {
+	return closeReaders(d.Readers)
+}
+
+// closeReaders closes readers from last (innermost) to first (outermost), returning the first
+// error encountered, if any.
+func closeReaders(readers []reader) error {
+	var err error
+	for i := len(readers) - 1; i >= 0; i-- {
+		if e := readers[i].rdr.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// dataStreamSelector opens the transport-level reader for d.url (http or file) and appends it as
+// the first entry in d.Readers.
+func (d *DataStream) dataStreamSelector() error {
+	switch d.url.Scheme {
+	case "http", "https":
+		rdr, err := d.newHTTPReader()
+		if err != nil {
+			return err
+		}
+		d.appendReader(rdr)
+		return nil
+	case "file", "":
+		f, err := appFs.Open(d.url.Path)
+		if err != nil {
+			return errors.Wrapf(err, "error opening file %q", d.url.Path)
+		}
+		d.appendReader(f)
+		return nil
+	default:
+		return errors.Errorf("unsupported source scheme %q", d.url.Scheme)
+	}
+}
+
+// newHTTPReader opens d.url for reading, transparently resuming via Range requests if the
+// connection drops mid-transfer and the server advertises Accept-Ranges: bytes.
+func (d *DataStream) newHTTPReader() (io.ReadCloser, error) {
+	return newResumableHTTPReader(d.url.String())
+}
+
+// constructReaders builds the full decode pipeline on top of the transport reader: gzip/xz
+// decompression layers, each followed by a multi-reader so the header bytes peeked for format
+// detection remain available to the next layer.
+func (d *DataStream) constructReaders() error {
+	if err := d.dataStreamSelector(); err != nil {
+		return err
+	}
+
+	for {
+		hdr, err := d.peek(image.MaxExpectedHdrSize)
+		if err != nil {
+			return errors.Wrap(err, "error peeking at stream header")
+		}
+		d.appendMultiReader(hdr)
+
+		switch {
+		case image.MatchHeader(hdr, image.ExtGz):
+			gz, err := gzip.NewReader(d.topReader())
+			if err != nil {
+				return errors.Wrap(err, "error constructing gzip reader")
+			}
+			d.appendReader(gz)
+		case image.MatchHeader(hdr, image.ExtXz):
+			xzr, err := xz.NewReader(d.topReader())
+			if err != nil {
+				return errors.Wrap(err, "error constructing xz reader")
+			}
+			d.appendReader(ioutil.NopCloser(xzr))
+		case image.MatchHeader(hdr, image.ExtTar):
+			if err := d.selectTarMember(); err != nil {
+				return errors.Wrap(err, "error selecting tar archive member")
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// peek reads up to n bytes from the current top reader. The caller must push the bytes back in
+// front of the chain via appendMultiReader so they remain visible downstream.
+func (d *DataStream) peek(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := io.ReadFull(d.topReader(), buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return buf[:read], nil
+}
+
+// appendMultiReader pushes hdr back in front of the current top reader, so bytes already consumed
+// by peek() remain visible to the next layer.
+func (d *DataStream) appendMultiReader(hdr []byte) {
+	mr := io.MultiReader(bytes.NewReader(hdr), d.topReader())
+	d.appendReader(ioutil.NopCloser(mr))
+}
+
+// appendReader appends rdr as the new top of the reader chain.
+func (d *DataStream) appendReader(rdr io.ReadCloser) {
+	d.Readers = append(d.Readers, reader{rdrLevel: len(d.Readers), rdr: rdr})
+}
+
+// topReader returns the current innermost reader in the chain.
+func (d *DataStream) topReader() io.ReadCloser {
+	return d.Readers[len(d.Readers)-1].rdr
+}
+
+// CopyImage copies the image found at endpoint to dest, converting qcow2 to raw via qemu-img when
+// necessary. When digest is non-empty (an "algo:hex" string, e.g. "sha256:abcd...") the payload
+// actually streamed from endpoint is verified against it as soon as it has been fully read, before
+// any qemu-img conversion/validation runs on it; a mismatch removes the partial output and returns
+// an error without ever invoking qemu-img on unverified content. Without a digest, a plain
+// (uncompressed, untarred) qcow2 image at an http(s) endpoint is converted by qemu-img straight
+// from its URL and the result validated, instead of being downloaded to a temp file first.
+func CopyImage(dest, endpoint, accessKey, secKey, digest string) error {
+	ds, err := NewDataStreamWithDigest(endpoint, accessKey, secKey, digest)
+	if err != nil {
+		return errors.Wrap(err, "error constructing data stream")
+	}
+	defer ds.Close()
+
+	// only the transport reader and its header multi-reader: no gzip/xz/tar layer in between
+	plain := len(ds.Readers) == 2
+	hdr, err := ds.peek(image.MaxExpectedHdrSize)
+	if err != nil {
+		return errors.Wrap(err, "error peeking at image header")
+	}
+	ds.appendMultiReader(hdr)
+	qemu := image.MatchHeader(hdr, image.ExtQcow2)
+
+	if qemu && plain && digest == "" && (ds.url.Scheme == "http" || ds.url.Scheme == "https") {
+		if err := qemuOperations.ConvertQcow2ToRawStream(ds.url, dest); err != nil {
+			return errors.Wrap(err, "error streaming qcow2 image to raw")
+		}
+		if err := qemuOperations.Validate(dest, "raw"); err != nil {
+			return errors.Wrap(err, "error validating converted image")
+		}
+		return nil
+	}
+
+	return copy(ds, dest, qemu, ds.VerifyDigest)
+}
+
+// copy streams r to out, then calls verify (if non-nil) on the fully-streamed content before
+// converting via qemu-img when qemu is true and validating the result; this lets callers reject a
+// tampered/truncated payload before it is ever handed to qemu-img. A pooled buffer is used with
+// io.CopyBuffer, sized by copyBufferSize/CDI_COPY_BUFFER_SIZE, to avoid io.Copy's default 32 KiB
+// buffer causing excessive syscalls/GC pressure on multi-GB images.
+func copy(r io.Reader, out string, qemu bool, verify func() error) error {
+	buf := getCopyBuffer()
+	defer putCopyBuffer(buf)
+
+	if !qemu {
+		f, err := appFs.Create(out)
+		if err != nil {
+			return errors.Wrapf(err, "error creating file %q", out)
+		}
+		if _, err := io.CopyBuffer(f, r, buf); err != nil {
+			f.Close()
+			return errors.Wrap(err, "error streaming data to file")
+		}
+		f.Close()
+		if verify != nil {
+			if err := verify(); err != nil {
+				appFs.Remove(out)
+				return err
+			}
+		}
+		return nil
+	}
+
+	tmpFile := randTmpName(out)
+	f, err := appFs.Create(tmpFile)
+	if err != nil {
+		return errors.Wrapf(err, "error creating temp file %q", tmpFile)
+	}
+	if _, err := io.CopyBuffer(f, r, buf); err != nil {
+		f.Close()
+		appFs.Remove(tmpFile)
+		return errors.Wrap(err, "error streaming qcow2 data to temp file")
+	}
+	f.Close()
+	defer appFs.Remove(tmpFile)
+
+	if verify != nil {
+		if err := verify(); err != nil {
+			return err
+		}
+	}
+
+	if err := qemuOperations.ConvertQcow2ToRaw(tmpFile, out); err != nil {
+		return errors.Wrap(err, "error converting qcow2 to raw")
+	}
+	if err := qemuOperations.Validate(out, "raw"); err != nil {
+		return errors.Wrap(err, "error validating converted image")
+	}
+	return nil
+}
+
+// randTmpName returns a random temp file path derived from src, placed alongside it.
+func randTmpName(src string) string {
+	dir, file := filepath.Split(src)
+	randBytes := make([]byte, 8)
+	rand.Read(randBytes)
+	return filepath.Join(dir, file+hex.EncodeToString(randBytes))
+}
@@ -1,7 +1,11 @@
 package importer
 
 import (
+	"archive/tar"
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -18,6 +22,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/spf13/afero"
+
 	"kubevirt.io/containerized-data-importer/pkg/image"
 	"kubevirt.io/containerized-data-importer/tests/utils"
 )
@@ -60,6 +66,34 @@ func replaceQEMUOperations(replacement image.QEMUOperations, f func()) {
 	f()
 }
 
+// replaceFs swaps appFs for the duration of f, then restores the original. Mirrors
+// replaceQEMUOperations above.
+func replaceFs(replacement afero.Fs, f func()) {
+	orig := appFs
+	if replacement != nil {
+		appFs = replacement
+		defer func() { appFs = orig }()
+	}
+	f()
+}
+
+// memMapFsWithFixture returns an afero.MemMapFs seeded, at the same path getTestFilePath would
+// resolve to, with the real on-disk content of testfile. This lets Test_dataStream_Read and
+// Test_dataStream_constructReaders exercise the DataStream pipeline against an in-memory
+// filesystem instead of the shared tests/images directory.
+func memMapFsWithFixture(t *testing.T, testfile string) afero.Fs {
+	t.Helper()
+	content, err := ioutil.ReadFile(getTestFilePath(testfile))
+	if err != nil {
+		t.Fatalf("error reading fixture %q: %v", testfile, err)
+	}
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, getTestFilePath(testfile), content, 0644); err != nil {
+		t.Fatalf("error seeding mem-map fs with fixture %q: %v", testfile, err)
+	}
+	return fs
+}
+
 func createDataStream(ep, accKey, secKey string) *DataStream {
 	dsurl, _ := ParseEndpoint(ep)
 
@@ -91,9 +125,7 @@ func createDataStreamBytes(testfile, ep string, defaultBuf, singlereader bool) (
 		return ds, []byte{'T', 'E', 'S', 'T'}, nil
 	}
 
-	f, _ := os.Open(testFilePath)
-	defer f.Close()
-	testBytes, err := ioutil.ReadAll(f)
+	testBytes, err := afero.ReadFile(appFs, testFilePath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Unable to read datastream buffer")
 	}
@@ -102,14 +134,9 @@ func createDataStreamBytes(testfile, ep string, defaultBuf, singlereader bool) (
 }
 
 func getFileSize(testfile string) (int, error) {
-	f, err := os.Open(getTestFilePath(testfile))
-	defer f.Close()
+	fi, err := appFs.Stat(getTestFilePath(testfile))
 	if err != nil {
-		return 0, fmt.Errorf("Unable to open source datastream file %s", getTestFilePath(testfile))
-	}
-	fi, err := f.Stat()
-	if err != nil {
-		return 0, fmt.Errorf("Unable to stat file %v", f.Name())
+		return 0, fmt.Errorf("Unable to stat file %s", getTestFilePath(testfile))
 	}
 
 	return int(fi.Size()), nil
@@ -132,7 +159,7 @@ func getURLPath(testfile string) string {
 func startHTTPServer(port int, dir string) (*http.Server, error) {
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
-		Handler: http.FileServer(http.Dir(dir)),
+		Handler: http.FileServer(afero.NewHttpFs(appFs).Dir(dir)),
 	}
 
 	go func() {
@@ -162,6 +189,121 @@ func startHTTPServer(port int, dir string) (*http.Server, error) {
 	return server, nil
 }
 
+// http.FileServer (used by startHTTPServer) already honors Range requests out of the box, so no
+// changes are needed there to exercise resumableHTTPReader against bytes=N-, bytes=N-M and
+// bytes=-N style ranges.
+
+func Test_contentRangeTotal(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   int64
+		wantOk bool
+	}{
+		{name: "well-formed content-range", header: "bytes 0-0/12345", want: 12345, wantOk: true},
+		{name: "missing total", header: "bytes 0-0/*", wantOk: false},
+		{name: "empty header", header: "", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := contentRangeTotal(tt.header)
+			if ok != tt.wantOk {
+				t.Errorf("contentRangeTotal() ok = %v, wantOk %v", ok, tt.wantOk)
+				return
+			}
+			if ok && got != tt.want {
+				t.Errorf("contentRangeTotal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resumableHTTPReader_fullRead(t *testing.T) {
+	imageDir, _ := filepath.Abs(TestImagesDir)
+	port := 9998
+	server, err := startHTTPServer(port, imageDir)
+	if err != nil {
+		t.Fatalf("Error setting up http server for resume test: %v", err)
+	}
+	defer server.Shutdown(nil)
+
+	expectedSize, err := getFileSize("tinyCore.iso")
+	if err != nil {
+		t.Fatalf("error getting test file size: %v", err)
+	}
+
+	r, err := newResumableHTTPReader(fmt.Sprintf("http://localhost:%d/tinyCore.iso", port))
+	if err != nil {
+		t.Fatalf("newResumableHTTPReader() error = %v", err)
+	}
+	defer r.Close()
+	if !r.acceptRanges {
+		t.Errorf("expected http.FileServer to advertise Accept-Ranges support")
+	}
+
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Errorf("unexpected error reading resumable http body: %v", err)
+	}
+	if len(got) != expectedSize {
+		t.Errorf("resumableHTTPReader read %d bytes, want %d", len(got), expectedSize)
+	}
+}
+
+// erroringReader always fails with a resumable error, used to simulate a dropped connection.
+type erroringReader struct{}
+
+func (e *erroringReader) Read([]byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func Test_resumableHTTPReader_resumeAfterDrop(t *testing.T) {
+	imageDir, _ := filepath.Abs(TestImagesDir)
+	port := 9997
+	server, err := startHTTPServer(port, imageDir)
+	if err != nil {
+		t.Fatalf("Error setting up http server for resume test: %v", err)
+	}
+	defer server.Shutdown(nil)
+
+	expectedBytes, err := ioutil.ReadFile(filepath.Join(imageDir, "tinyCore.iso"))
+	if err != nil {
+		t.Fatalf("error reading fixture: %v", err)
+	}
+
+	r, err := newResumableHTTPReader(fmt.Sprintf("http://localhost:%d/tinyCore.iso", port))
+	if err != nil {
+		t.Fatalf("newResumableHTTPReader() error = %v", err)
+	}
+	defer r.Close()
+	if !r.acceptRanges {
+		t.Fatalf("expected http.FileServer to advertise Accept-Ranges support")
+	}
+
+	// Read a prefix normally, then swap in a body that fails immediately with a resumable error,
+	// simulating a connection dropped mid-stream. Read() should transparently reopen at the last
+	// offset read via resume(), and the remainder should read back identically to a clean read.
+	const dropAfter = 1024
+	prefix := make([]byte, dropAfter)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		t.Fatalf("error reading initial bytes: %v", err)
+	}
+	r.body = ioutil.NopCloser(&erroringReader{})
+
+	rest, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error reading after simulated drop: %v", err)
+	}
+
+	got := append(prefix, rest...)
+	if len(got) != len(expectedBytes) {
+		t.Fatalf("resumed read produced %d bytes, want %d", len(got), len(expectedBytes))
+	}
+	if !bytes.Equal(got, expectedBytes) {
+		t.Errorf("resumed read content does not match original file")
+	}
+}
+
 func TestNewDataStream(t *testing.T) {
 	type args struct {
 		endpt  string
@@ -229,25 +371,27 @@ func Test_dataStream_Read(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ds, testBytes, errDs := createDataStreamBytes(tt.testFile, "", true, true)
-			if errDs != nil {
-				t.Errorf("error setting up test infrastructure %v", errDs)
-			}
-			defer ds.Close()
+			replaceFs(memMapFsWithFixture(t, tt.testFile), func() {
+				ds, testBytes, errDs := createDataStreamBytes(tt.testFile, "", true, true)
+				if errDs != nil {
+					t.Errorf("error setting up test infrastructure %v", errDs)
+				}
+				defer ds.Close()
 
-			got, err := ds.Read(testBytes)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("dataStream.Read() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			expectedSize, errFs := getFileSize(tt.testFile)
-			if errFs != nil {
-				t.Errorf("error getting test file size %v", errFs)
-				return
-			}
-			if got != expectedSize {
-				t.Errorf("dataStream.Read() sizes do not match = %v, want %v", got, expectedSize)
-			}
+				got, err := ds.Read(testBytes)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("dataStream.Read() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				expectedSize, errFs := getFileSize(tt.testFile)
+				if errFs != nil {
+					t.Errorf("error getting test file size %v", errFs)
+					return
+				}
+				if got != expectedSize {
+					t.Errorf("dataStream.Read() sizes do not match = %v, want %v", got, expectedSize)
+				}
+			})
 		})
 	}
 }
@@ -328,6 +472,7 @@ func TestCopyImage(t *testing.T) {
 		endpoint       string
 		accessKey      string
 		secKey         string
+		digest         string
 		qemuOperations image.QEMUOperations
 	}
 	imageDir, _ := filepath.Abs(TestImagesDir)
@@ -353,6 +498,7 @@ func TestCopyImage(t *testing.T) {
 				filepath.Join(localImageBase, "tinyCore.iso"),
 				"",
 				"",
+				"",
 				NewQEMUAllErrors(),
 			},
 			wantErr: false,
@@ -364,6 +510,7 @@ func TestCopyImage(t *testing.T) {
 				filepath.Join(localImageBase, "tinyCoreBad.iso"),
 				"",
 				"",
+				"",
 				NewQEMUAllErrors(),
 			},
 			wantErr: true,
@@ -375,6 +522,7 @@ func TestCopyImage(t *testing.T) {
 				fmt.Sprintf("http://localhost:%d/cirros-qcow2.img", port),
 				"",
 				"",
+				"",
 				NewFakeQEMUOperations(errors.New("should not be called"), nil, nil),
 			},
 			wantErr: false,
@@ -386,6 +534,7 @@ func TestCopyImage(t *testing.T) {
 				fmt.Sprintf("http://localhost:%d/cirros-qcow2.img", port),
 				"",
 				"",
+				"",
 				NewFakeQEMUOperations(nil, nil, errors.New("invalid image")),
 			},
 			wantErr: true,
@@ -397,6 +546,7 @@ func TestCopyImage(t *testing.T) {
 				fmt.Sprintf("http://localhost:%d/cirros-qcow2.img", port),
 				"",
 				"",
+				"",
 				NewFakeQEMUOperations(nil, errors.New("exit 1"), nil),
 			},
 			wantErr: true,
@@ -406,7 +556,7 @@ func TestCopyImage(t *testing.T) {
 		defer os.RemoveAll(tt.args.dest)
 		t.Run(tt.name, func(t *testing.T) {
 			replaceQEMUOperations(tt.args.qemuOperations, func() {
-				if err := CopyImage(tt.args.dest, tt.args.endpoint, tt.args.accessKey, tt.args.secKey); (err != nil) != tt.wantErr {
+				if err := CopyImage(tt.args.dest, tt.args.endpoint, tt.args.accessKey, tt.args.secKey, tt.args.digest); (err != nil) != tt.wantErr {
 					t.Errorf("CopyImage() error = %v, wantErr %v", err, tt.wantErr)
 				}
 			})
@@ -432,65 +582,216 @@ func Test_dataStream_constructReaders(t *testing.T) {
 	imageDir, _ := filepath.Abs(TestImagesDir)
 	localImageBase := filepath.Join("file://", imageDir) //TODO: use file server
 
+	// xz/gz fixtures are produced on-disk by the external tests/utils.FormatTestData helper, so
+	// those two cases still exercise the real OS filesystem; the plain qcow2/iso/bad-path cases
+	// below run against an in-memory afero.MemMapFs seeded via memMapFsWithFixture.
 	testfiles := createTestData()
 
 	tests := []struct {
-		name    string
-		outfile string
-		ds      *DataStream
-		numRdrs int
-		wantErr bool
+		name     string
+		outfile  string
+		endpoint string
+		seed     string // fixture filename to seed into a mem-map fs; "" uses the real OS fs
+		numRdrs  int
 	}{
 		{
-			name:    "successfully construct a xz reader",
-			outfile: "tinyCore.iso.xz",
-			ds:      createDataStream(filepath.Join("file://", testfiles[".xz"]), "", ""), //TODO: use file server
-			numRdrs: 4, // [http, multi-r, xz, multi-r]
-			wantErr: false,
+			name:     "successfully construct a xz reader",
+			outfile:  "tinyCore.iso.xz",
+			endpoint: filepath.Join("file://", testfiles[".xz"]), //TODO: use file server
+			numRdrs:  4,                                          // [file, multi-r, xz, multi-r]
 		},
 		{
-			name:    "successfully construct a gz reader",
-			outfile: "tinyCore.iso.gz",
-			ds:      createDataStream(filepath.Join("file://", testfiles[".gz"]), "", ""), //TODO: use file server
-			numRdrs: 4, // [http, multi-r, gz, multi-r]
-			wantErr: false,
+			name:     "successfully construct a gz reader",
+			outfile:  "tinyCore.iso.gz",
+			endpoint: filepath.Join("file://", testfiles[".gz"]), //TODO: use file server
+			numRdrs:  4,                                          // [file, multi-r, gz, multi-r]
 		},
 		{
-			name:    "successfully construct qcow2 reader",
-			outfile: "",
-			ds:      createDataStream(filepath.Join(localImageBase, "cirros-qcow2.img"), "", ""),
-			numRdrs: 2, // [http, multi-r]
-			wantErr: false,
+			name:     "successfully construct qcow2 reader",
+			endpoint: filepath.Join(localImageBase, "cirros-qcow2.img"),
+			seed:     "cirros-qcow2.img",
+			numRdrs:  2, // [file, multi-r]
 		},
 		{
-			name:    "successfully construct .iso reader",
-			outfile: "",
-			ds:      createDataStream(filepath.Join(localImageBase, "tinyCore.iso"), "", ""),
-			numRdrs: 2, // [http, multi-r]
-			wantErr: false,
+			name:     "successfully construct .iso reader",
+			endpoint: filepath.Join(localImageBase, "tinyCore.iso"),
+			seed:     "tinyCore.iso",
+			numRdrs:  2, // [file, multi-r]
 		},
 		{
-			name:    "fail constructing reader for invalid file path",
-			outfile: "",
-			ds:      createDataStream(filepath.Join(localImageBase, "tinyCorebad.iso"), "", ""),
-			numRdrs: 0,
-			wantErr: true,
+			name:     "fail constructing reader for invalid file path",
+			endpoint: filepath.Join(localImageBase, "tinyCorebad.iso"),
+			seed:     "tinyCore.iso", // seed an unrelated fixture; tinyCorebad.iso stays absent
+			numRdrs:  0,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			defer tt.ds.Close()
-			actualNumRdrs := len(tt.ds.Readers)
-			if tt.numRdrs != actualNumRdrs {
-				t.Errorf("dataStream.constructReaders(): expect num-readers to be %d, got %d", tt.numRdrs, actualNumRdrs)
+			run := func() {
+				ds := createDataStream(tt.endpoint, "", "")
+				defer ds.Close()
+				actualNumRdrs := len(ds.Readers)
+				if tt.numRdrs != actualNumRdrs {
+					t.Errorf("dataStream.constructReaders(): expect num-readers to be %d, got %d", tt.numRdrs, actualNumRdrs)
+				}
+				if len(tt.outfile) > 0 {
+					os.Remove(filepath.Join(os.TempDir(), tt.outfile))
+				}
+			}
+			if tt.seed != "" {
+				replaceFs(memMapFsWithFixture(t, tt.seed), run)
+			} else {
+				run()
+			}
+		})
+	}
+}
+
+func Test_dataStream_digest(t *testing.T) {
+	imageDir, _ := filepath.Abs(TestImagesDir)
+	localImageBase := filepath.Join("file://", imageDir) //TODO: use file server
+
+	raw, err := ioutil.ReadFile(filepath.Join(imageDir, "tinyCore.iso"))
+	if err != nil {
+		t.Fatalf("error reading test fixture: %v", err)
+	}
+	sum := sha256.Sum256(raw)
+	goodDigest := "sha256:" + hex.EncodeToString(sum[:])
+	badDigest := "sha256:" + strings.Repeat("0", hex.EncodedLen(sha256.Size))
+
+	tests := []struct {
+		name    string
+		digest  string
+		wantErr bool
+	}{
+		{name: "matching digest verifies successfully", digest: goodDigest, wantErr: false},
+		{name: "corrupted digest fails verification", digest: badDigest, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds, err := NewDataStreamWithDigest(filepath.Join(localImageBase, "tinyCore.iso"), "", "", tt.digest)
+			if err != nil {
+				t.Fatalf("NewDataStreamWithDigest() error = %v", err)
+			}
+			defer ds.Close()
+
+			if _, err := ioutil.ReadAll(ds); err != nil {
+				t.Fatalf("error reading data stream: %v", err)
 			}
-			if len(tt.outfile) > 0 {
-				os.Remove(filepath.Join(os.TempDir(), tt.outfile))
+			if err := ds.VerifyDigest(); (err != nil) != tt.wantErr {
+				t.Errorf("VerifyDigest() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
+// tarEntry is one member of a fixture built by buildTarGz.
+type tarEntry struct {
+	name    string
+	content string
+}
+
+// buildTarGz gzip-compresses a tar archive containing entries, in order, for use as an in-memory
+// multi-member .tar.gz fixture.
+func buildTarGz(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("error writing tar header for %q: %v", e.name, err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatalf("error writing tar content for %q: %v", e.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("error closing tar writer: %v", err)
+	}
+
+	var gzBuf bytes.Buffer
+	gw := gzip.NewWriter(&gzBuf)
+	if _, err := gw.Write(tarBuf.Bytes()); err != nil {
+		t.Fatalf("error gzip-compressing tar fixture: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("error closing gzip writer: %v", err)
+	}
+	return gzBuf.Bytes()
+}
+
+func Test_dataStream_tarArchiveMember(t *testing.T) {
+	fixturePath := filepath.Join(getTestFilePath(""), "multi.tar.gz")
+	fileA := "disk-a contents"
+	fileB := "disk-b contents, a bit longer than disk-a"
+	content := buildTarGz(t, []tarEntry{
+		{name: "disk-a.img", content: fileA},
+		{name: "disk-b.img", content: fileB},
+	})
+
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, fixturePath, content, 0644); err != nil {
+		t.Fatalf("error seeding mem-map fs: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		archiveMember string
+		wantBytes     string
+		wantErr       bool
+	}{
+		{name: "selects named member", archiveMember: "disk-b.img", wantBytes: fileB},
+		{name: "defaults to first regular entry when unset", wantBytes: fileA},
+		{name: "fails for unknown member", archiveMember: "disk-c.img", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replaceFs(fs, func() {
+				endpoint := "file://" + fixturePath
+				if tt.archiveMember != "" {
+					endpoint += "?archiveMember=" + tt.archiveMember
+				}
+				ds, err := NewDataStream(endpoint, "", "")
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("NewDataStream() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err != nil {
+					return
+				}
+				defer ds.Close()
+
+				got, err := ioutil.ReadAll(ds)
+				if err != nil {
+					t.Fatalf("error reading selected tar member: %v", err)
+				}
+				if string(got) != tt.wantBytes {
+					t.Errorf("read %q, want %q", string(got), tt.wantBytes)
+				}
+			})
+		})
+	}
+}
+
+func Test_dataStream_tarTraversalRejection(t *testing.T) {
+	fixturePath := filepath.Join(getTestFilePath(""), "traversal.tar.gz")
+	content := buildTarGz(t, []tarEntry{
+		{name: "../escape.img", content: "should never be exposed"},
+	})
+
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, fixturePath, content, 0644); err != nil {
+		t.Fatalf("error seeding mem-map fs: %v", err)
+	}
+
+	replaceFs(fs, func() {
+		if _, err := NewDataStream("file://"+fixturePath, "", ""); err == nil {
+			t.Error("expected NewDataStream() to reject a tar entry with a \"..\" path segment")
+		}
+	})
+}
+
 func Test_closeReaders(t *testing.T) {
 	type args struct {
 		readers []reader
@@ -533,9 +834,8 @@ func Test_copy(t *testing.T) {
 	rdrs1 := strings.NewReader("test data for reader 1")
 
 	imageDir, _ := filepath.Abs(TestImagesDir)
-	file := filepath.Join(imageDir, "cirros-qcow2.img")
-	rdrfile, _ := os.Open(file)
-	rdrs2 := bufio.NewReader(rdrfile)
+	fileBytes, _ := ioutil.ReadFile(filepath.Join(imageDir, "cirros-qcow2.img"))
+	rdrs2 := bufio.NewReader(bytes.NewReader(fileBytes))
 
 	tests := []struct {
 		name    string
@@ -565,16 +865,34 @@ func Test_copy(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			defer os.Remove(tt.args.out)
-			replaceQEMUOperations(tt.args.qemuOperations, func() {
-				if err := copy(tt.args.r, tt.args.out, tt.args.qemu); (err != nil) != tt.wantErr {
-					t.Errorf("copy() error = %v, wantErr %v", err, tt.wantErr)
-				}
+			replaceFs(afero.NewMemMapFs(), func() {
+				replaceQEMUOperations(tt.args.qemuOperations, func() {
+					if err := copy(tt.args.r, tt.args.out, tt.args.qemu, nil); (err != nil) != tt.wantErr {
+						t.Errorf("copy() error = %v, wantErr %v", err, tt.wantErr)
+					}
+				})
 			})
 		})
 	}
 }
 
+// Benchmark_copy measures copy() throughput on a large temp file, guarding against regressions in
+// the pooled-buffer io.CopyBuffer path.
+func Benchmark_copy(b *testing.B) {
+	const size = 256 << 20 // 256 MiB
+	src := make([]byte, size)
+	out := filepath.Join(os.TempDir(), "benchmark_copy_out")
+	defer os.Remove(out)
+
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := copy(bytes.NewReader(src), out, false, nil); err != nil {
+			b.Fatalf("copy() error = %v", err)
+		}
+	}
+}
+
 func Test_randTmpName(t *testing.T) {
 	const numbyte = 8
 
@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// parseDigest splits a digest string of the form "algo:hex" (e.g. "sha256:abcd...") into its algo
+// and hex-encoded value.
+func parseDigest(digest string) (algo, hexVal string, err error) {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.Errorf("digest %q is not of the form \"algo:hex\"", digest)
+	}
+	return parts[0], parts[1], nil
+}
+
+// newHasher returns a hash.Hash for the given digest algorithm.
+func newHasher(algo string) (hash.Hash, error) {
+	switch algo {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "md5":
+		return md5.New(), nil
+	default:
+		return nil, errors.Errorf("unsupported digest algorithm %q", algo)
+	}
+}
+
+// setDigest configures d to verify its payload against digest (an "algo:hex" string) as it is read,
+// by appending a TeeReader over the current top (innermost, last) reader in the chain.
+func (d *DataStream) setDigest(digest string) error {
+	algo, hexVal, err := parseDigest(digest)
+	if err != nil {
+		return err
+	}
+	h, err := newHasher(algo)
+	if err != nil {
+		return err
+	}
+	d.digestAlgo = algo
+	d.expectedDigest = hexVal
+	d.hasher = h
+	d.appendReader(ioutil.NopCloser(io.TeeReader(d.topReader(), h)))
+	return nil
+}
+
+// VerifyDigest compares the running hash accumulated as d was read against the expected digest
+// configured via setDigest/NewDataStreamWithDigest. It is a no-op (returns nil) if no digest was
+// configured.
+func (d *DataStream) VerifyDigest() error {
+	if d.hasher == nil {
+		return nil
+	}
+	got := hex.EncodeToString(d.hasher.Sum(nil))
+	if got != d.expectedDigest {
+		return errors.Errorf("content digest mismatch: computed %s:%s, expected %s:%s", d.digestAlgo, got, d.digestAlgo, d.expectedDigest)
+	}
+	return nil
+}
+
+// NewDataStreamWithDigest constructs a DataStream the same way NewDataStream does, additionally
+// configuring it to verify its payload against the expected digest (an "algo:hex" string, e.g.
+// "sha256:abcd..."). Passing an empty digest is equivalent to NewDataStream.
+func NewDataStreamWithDigest(endpt, accKey, secKey, digest string) (*DataStream, error) {
+	ds, err := NewDataStream(endpt, accKey, secKey)
+	if err != nil {
+		return nil, err
+	}
+	if digest == "" {
+		return ds, nil
+	}
+	if err := ds.setDigest(digest); err != nil {
+		ds.Close()
+		return nil, err
+	}
+	return ds, nil
+}
@@ -0,0 +1,11 @@
+package importer
+
+import (
+	"github.com/spf13/afero"
+)
+
+// appFs is the filesystem DataStream reads "file://" endpoints from, and copy() writes its output
+// to. Production code uses the real OS filesystem; tests can swap in an in-memory
+// afero.MemMapFs (via replaceFs in dataStream_test.go), seeded with image fixtures where needed.
+// Tests that do not swap it still read the host filesystem and the shared tests/images directory.
+var appFs afero.Fs = afero.NewOsFs()
@@ -0,0 +1,191 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// maxHTTPResumeAttempts bounds how many times a dropped HTTP download is reopened with a Range
+// request before giving up and surfacing the error to the caller.
+const maxHTTPResumeAttempts = 5
+
+// httpResumeBaseBackoff is the starting delay between resume attempts; it is doubled (capped) on
+// each successive retry.
+const httpResumeBaseBackoff = 500 * time.Millisecond
+
+// httpResumeMaxBackoff caps the exponential backoff between resume attempts.
+const httpResumeMaxBackoff = 10 * time.Second
+
+// resumableHTTPReader wraps the response body of an HTTP GET and, when the server advertises
+// Accept-Ranges: bytes, transparently reopens the connection with a Range request starting at the
+// last byte successfully read whenever the underlying body returns a retryable error.
+type resumableHTTPReader struct {
+	url          string
+	body         io.ReadCloser
+	bytesRead    int64
+	contentLen   int64
+	acceptRanges bool
+	etag         string
+	lastModified string
+}
+
+// newResumableHTTPReader issues a probe GET with "Range: bytes=0-0" to determine whether endpoint
+// supports range requests, then opens (and returns) the real full-body GET. The probe's
+// Content-Length/ETag/Last-Modified are recorded so later resumes can detect a mid-flight object
+// change and reject the resume.
+func newResumableHTTPReader(endpoint string) (*resumableHTTPReader, error) {
+	r := &resumableHTTPReader{url: endpoint}
+
+	probeReq, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http probe request")
+	}
+	probeReq.Header.Set("Range", "bytes=0-0")
+	probeResp, err := http.DefaultClient.Do(probeReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "error probing http endpoint for range support")
+	}
+	probeResp.Body.Close()
+
+	if probeResp.StatusCode == http.StatusPartialContent && probeResp.Header.Get("Accept-Ranges") != "none" {
+		r.acceptRanges = true
+		if total, ok := contentRangeTotal(probeResp.Header.Get("Content-Range")); ok {
+			r.contentLen = total
+		}
+	} else if cl := probeResp.Header.Get("Content-Length"); cl != "" {
+		if n, err := strconv.ParseInt(cl, 10, 64); err == nil {
+			r.contentLen = n
+		}
+	}
+	r.etag = probeResp.Header.Get("ETag")
+	r.lastModified = probeResp.Header.Get("Last-Modified")
+
+	body, err := r.open(0)
+	if err != nil {
+		return nil, err
+	}
+	r.body = body
+	return r, nil
+}
+
+// open issues a GET for r.url starting at byte offset, validating the response's ETag/Last-Modified
+// (when the original values were recorded) so a mid-flight object change is rejected rather than
+// silently resumed against different content.
+func (r *resumableHTTPReader) open(offset int64) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http request")
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error performing http request")
+	}
+
+	if offset > 0 {
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			return nil, errors.Errorf("resume request for %q did not return 206 Partial Content (got %d)", r.url, resp.StatusCode)
+		}
+		total, ok := contentRangeTotal(resp.Header.Get("Content-Range"))
+		if !ok || (r.contentLen != 0 && total != r.contentLen) {
+			resp.Body.Close()
+			return nil, errors.Errorf("resume request for %q returned unexpected Content-Range %q", r.url, resp.Header.Get("Content-Range"))
+		}
+	} else if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, errors.Errorf("http request to %q returned status %d", r.url, resp.StatusCode)
+	}
+
+	if r.etag != "" && resp.Header.Get("ETag") != "" && resp.Header.Get("ETag") != r.etag {
+		resp.Body.Close()
+		return nil, errors.Errorf("object at %q changed (ETag mismatch) during resume", r.url)
+	}
+	if r.lastModified != "" && resp.Header.Get("Last-Modified") != "" && resp.Header.Get("Last-Modified") != r.lastModified {
+		resp.Body.Close()
+		return nil, errors.Errorf("object at %q changed (Last-Modified mismatch) during resume", r.url)
+	}
+
+	return resp.Body, nil
+}
+
+// Read implements io.Reader, transparently resuming via Range requests on a dropped connection.
+func (r *resumableHTTPReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.bytesRead += int64(n)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	if !r.acceptRanges || !isResumableError(err) {
+		return n, err
+	}
+
+	resumeErr := r.resume()
+	if resumeErr != nil {
+		return n, errors.Wrap(resumeErr, "error resuming dropped http download")
+	}
+	return n, nil
+}
+
+// resume reopens the download at r.bytesRead, retrying with capped exponential backoff up to
+// maxHTTPResumeAttempts times.
+func (r *resumableHTTPReader) resume() error {
+	r.body.Close()
+
+	backoff := httpResumeBaseBackoff
+	var lastErr error
+	for attempt := 1; attempt <= maxHTTPResumeAttempts; attempt++ {
+		glog.V(1).Infof("resuming http download of %q at offset %d (attempt %d/%d)\n", r.url, r.bytesRead, attempt, maxHTTPResumeAttempts)
+		body, err := r.open(r.bytesRead)
+		if err == nil {
+			r.body = body
+			return nil
+		}
+		lastErr = err
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > httpResumeMaxBackoff {
+			backoff = httpResumeMaxBackoff
+		}
+	}
+	return errors.Wrapf(lastErr, "giving up after %d resume attempts", maxHTTPResumeAttempts)
+}
+
+// Close closes the current underlying body.
+func (r *resumableHTTPReader) Close() error {
+	return r.body.Close()
+}
+
+// isResumableError reports whether err is the kind of mid-stream failure a Range-request resume
+// can recover from.
+func isResumableError(err error) bool {
+	if err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return false
+}
+
+// contentRangeTotal parses the total length out of a "Content-Range: bytes 0-0/12345" header value.
+func contentRangeTotal(cr string) (int64, bool) {
+	idx := strings.LastIndex(cr, "/")
+	if idx < 0 || idx == len(cr)-1 {
+		return 0, false
+	}
+	total, err := strconv.ParseInt(cr[idx+1:], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return total, true
+}